@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cloudflare/cloudflare-go"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+)
+
+// DNSProvider solves ACME dns-01 challenges by creating and removing
+// "_acme-challenge" TXT records through the same Cloudflare API client
+// and zone flareupd already authenticates with. It satisfies lego's
+// challenge.Provider interface.
+type DNSProvider struct {
+	Api    *cloudflare.API
+	ZoneId string
+
+	mu        sync.Mutex
+	recordIDs map[string]string
+}
+
+func NewDNSProvider(api *cloudflare.API, zoneId string) *DNSProvider {
+	return &DNSProvider{Api: api, ZoneId: zoneId, recordIDs: make(map[string]string)}
+}
+
+func (p *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+
+	params := cloudflare.CreateDNSRecordParams{
+		Type:    "TXT",
+		Name:    fqdn,
+		Content: value,
+		TTL:     120,
+	}
+
+	res, err := p.Api.CreateDNSRecord(context.Background(), cloudflare.ZoneIdentifier(p.ZoneId), params)
+	if err != nil {
+		return fmt.Errorf("failed to create ACME challenge record '%s': %w", fqdn, err)
+	}
+
+	p.mu.Lock()
+	p.recordIDs[fqdn] = res.ID
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
+
+	p.mu.Lock()
+	id, ok := p.recordIDs[fqdn]
+	delete(p.recordIDs, fqdn)
+	p.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	if err := p.Api.DeleteDNSRecord(context.Background(), cloudflare.ZoneIdentifier(p.ZoneId), id); err != nil {
+		return fmt.Errorf("failed to delete ACME challenge record '%s': %w", fqdn, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/registration"
+)
+
+const (
+	AcmeCADirUrl      = lego.LEDirectoryProduction
+	CertRenewBefore   = 30 * 24 * time.Hour
+	CertCheckInterval = 12 * time.Hour
+)
+
+// acmeUser implements lego's registration.User, backed by an in-memory
+// account key generated once per run.
+type acmeUser struct {
+	email        string
+	registration *registration.Resource
+	key          crypto.PrivateKey
+}
+
+func (u *acmeUser) GetEmail() string                        { return u.email }
+func (u *acmeUser) GetRegistration() *registration.Resource { return u.registration }
+func (u *acmeUser) GetPrivateKey() crypto.PrivateKey        { return u.key }
+
+// CertManager obtains and renews a TLS certificate for Domain via ACME
+// dns-01, writing fullchain.pem/privkey.pem into CertDir/<Domain>/.
+type CertManager struct {
+	Domain   string
+	Email    string
+	CertDir  string
+	Provider *DNSProvider
+}
+
+func (c *CertManager) certPath() string { return filepath.Join(c.CertDir, c.Domain, "fullchain.pem") }
+func (c *CertManager) keyPath() string  { return filepath.Join(c.CertDir, c.Domain, "privkey.pem") }
+
+// Run obtains a certificate immediately if one isn't already on disk, then
+// checks periodically and renews within CertRenewBefore of expiry, until
+// ctx is cancelled.
+//
+// Account registration and certificate issuance run on a background
+// goroutine because lego's Client in this version takes no context of its
+// own and can block indefinitely against a slow or unreachable ACME CA;
+// waiting for it here would stop Run (and the wg.Wait() in main) from
+// ever observing ctx cancellation.
+func (c *CertManager) Run(ctx context.Context) {
+	setup := make(chan *lego.Client, 1)
+	setupErr := make(chan error, 1)
+
+	go func() {
+		client, err := c.newClient()
+		if err != nil {
+			setupErr <- err
+			return
+		}
+
+		if !c.certExists() {
+			if err := c.obtain(client); err != nil {
+				slog.Error("Failed to obtain certificate", "domain", c.Domain, "error", err)
+			}
+		}
+
+		setup <- client
+	}()
+
+	var client *lego.Client
+	select {
+	case client = <-setup:
+	case err := <-setupErr:
+		slog.Error("Failed to set up ACME client", "domain", c.Domain, "error", err)
+		return
+	case <-ctx.Done():
+		return
+	}
+
+	ticker := time.NewTicker(CertCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			expiry, err := certExpiry(c.certPath())
+			if err != nil {
+				slog.Error("Failed to inspect certificate", "domain", c.Domain, "error", err)
+				continue
+			}
+
+			if time.Until(expiry) > CertRenewBefore {
+				continue
+			}
+
+			renewed := make(chan error, 1)
+			go func() { renewed <- c.obtain(client) }()
+
+			select {
+			case err := <-renewed:
+				if err != nil {
+					slog.Error("Failed to renew certificate", "domain", c.Domain, "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *CertManager) certExists() bool {
+	_, err := os.Stat(c.certPath())
+	return err == nil
+}
+
+func certExpiry(path string) (time.Time, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("no PEM block found in '%s'", path)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return cert.NotAfter, nil
+}
+
+func (c *CertManager) newClient() (*lego.Client, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate account key: %w", err)
+	}
+
+	user := &acmeUser{email: c.Email, key: key}
+
+	cfg := lego.NewConfig(user)
+	cfg.CADirURL = AcmeCADirUrl
+	cfg.Certificate.KeyType = certcrypto.EC256
+
+	client, err := lego.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ACME client: %w", err)
+	}
+
+	if err := client.Challenge.SetDNS01Provider(c.Provider); err != nil {
+		return nil, fmt.Errorf("failed to register dns-01 provider: %w", err)
+	}
+
+	reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+	user.registration = reg
+
+	return client, nil
+}
+
+func (c *CertManager) obtain(client *lego.Client) error {
+	slog.Info("Requesting certificate", "domain", c.Domain)
+
+	cert, err := client.Certificate.Obtain(certificate.ObtainRequest{
+		Domains: []string{c.Domain},
+		Bundle:  true,
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(c.CertDir, c.Domain)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cert directory '%s': %w", dir, err)
+	}
+
+	if err := os.WriteFile(c.certPath(), cert.Certificate, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	if err := os.WriteFile(c.keyPath(), cert.PrivateKey, 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+
+	slog.Info("Wrote certificate", "domain", c.Domain, "dir", dir)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration wraps time.Duration so refresh intervals can be written as
+// human-readable strings ("5m", "30s") in the config file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// RecordConfig describes a single DNS record flareupd keeps in sync with
+// its configured IP source.
+type RecordConfig struct {
+	Name     string     `yaml:"name"`
+	Type     string     `yaml:"type"`
+	TTL      int        `yaml:"ttl"`
+	Proxied  *bool      `yaml:"proxied"`
+	Priority *uint16    `yaml:"priority"`
+	Refresh  Duration   `yaml:"refresh"`
+	Sources  []string   `yaml:"sources"`
+	Quorum   int        `yaml:"quorum"`
+	TLS      *TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig requests automatic TLS certificate issuance and renewal for a
+// record's domain via ACME dns-01, solved through the same Cloudflare
+// zone the record itself is updated in.
+type TLSConfig struct {
+	Email   string `yaml:"email"`
+	CertDir string `yaml:"cert_dir"`
+}
+
+// ZoneConfig groups the records that belong to a single Cloudflare zone. ID
+// can be set to skip the zone-listing lookup for tokens scoped to one zone.
+type ZoneConfig struct {
+	Name    string         `yaml:"name"`
+	ID      string         `yaml:"id"`
+	Records []RecordConfig `yaml:"records"`
+}
+
+// Config is the top-level flareupd configuration file, listing every zone
+// and record the daemon should keep up to date.
+type Config struct {
+	Zones []ZoneConfig `yaml:"zones"`
+}
+
+// LoadConfig reads and parses a flareupd YAML config file from path.
+func LoadConfig(path string) (*Config, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file '%s': %w", path, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(bs, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+
+	return &cfg, nil
+}
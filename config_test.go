@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDurationUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "5m", want: 5 * time.Minute},
+		{in: "30s", want: 30 * time.Second},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: "not-a-duration", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var d Duration
+		err := yaml.Unmarshal([]byte(tt.in), &d)
+
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Duration.UnmarshalYAML(%q) = nil error, want error", tt.in)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Duration.UnmarshalYAML(%q) returned %v", tt.in, err)
+			continue
+		}
+
+		if time.Duration(d) != tt.want {
+			t.Errorf("Duration.UnmarshalYAML(%q) = %v, want %v", tt.in, time.Duration(d), tt.want)
+		}
+	}
+}
@@ -1,14 +1,13 @@
 package main
 
 import (
-	"io/ioutil"
+	"context"
+	"fmt"
 	"log"
-	"net"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
-	"strconv"
-	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -16,17 +15,19 @@ import (
 )
 
 const (
-	EnvVarIp4InfoUrl = "IP4_INFO_URL"
-	Ip4InfoUrl       = "https://v4.ident.me/"
-	EnvVarIp6InfoUrl = "IP6_INFO_URL"
-	Ip6InfoUrl       = "https://v6.ident.me/"
+	EnvVarConfigFile = "CONFIG_FILE"
+	ConfigFile       = "flareupd.yaml"
 
+	EnvVarCfApiToken = "CF_API_TOKEN"
 	EnvVarCfApiKey   = "CF_API_KEY"
 	EnvVarCfEmail    = "CF_API_EMAIL"
-	EnvVarCfZoneName = "CF_ZONE_NAME"
 
-	EnvVarRefresh = "REFRESH"
-	EnvVarEntry   = "ENTRY"
+	EnvVarMetricsAddr = "METRICS_ADDR"
+	EnvVarStateFile   = "STATE_FILE"
+
+	RetryMaxRetries   = 5
+	RetryMinDelaySecs = 1
+	RetryMaxDelaySecs = 30
 )
 
 func requiredEnvVariable(variable string) string {
@@ -38,15 +39,6 @@ func requiredEnvVariable(variable string) string {
 	return ""
 }
 
-func requiredEnvVariableTime(variable string) time.Duration {
-	value := requiredEnvVariable(variable)
-	t, err := strconv.Atoi(value)
-	if err != nil {
-		log.Fatalf("Environment variable '%s' is not a number", variable)
-	}
-	return time.Duration(t) * time.Second
-}
-
 func optionalEnvVariable(variable string, def string) string {
 	if val, ok := os.LookupEnv(variable); ok {
 		return val
@@ -55,167 +47,185 @@ func optionalEnvVariable(variable string, def string) string {
 	return def
 }
 
-func main() {
-	apiKey := requiredEnvVariable(EnvVarCfApiKey)
-	email := requiredEnvVariable(EnvVarCfEmail)
-	zoneName := requiredEnvVariable(EnvVarCfZoneName)
-	refresh := requiredEnvVariableTime(EnvVarRefresh)
-	entry := requiredEnvVariable(EnvVarEntry)
-
-	ip4Url := optionalEnvVariable(EnvVarIp4InfoUrl, Ip4InfoUrl)
-	ip6Url := optionalEnvVariable(EnvVarIp6InfoUrl, Ip6InfoUrl)
+// newCloudflareClient builds a Cloudflare API client from the environment,
+// preferring a scoped CF_API_TOKEN over the legacy CF_API_KEY/CF_API_EMAIL
+// pair. The two authentication schemes are mutually exclusive.
+func newCloudflareClient() *cloudflare.API {
+	token, hasToken := os.LookupEnv(EnvVarCfApiToken)
+	_, hasKey := os.LookupEnv(EnvVarCfApiKey)
+	_, hasEmail := os.LookupEnv(EnvVarCfEmail)
 
-	api, err := cloudflare.New(apiKey, email)
-	if err != nil {
-		log.Fatalf("Failed to create cloudflare client: %v", err)
+	if hasToken && (hasKey || hasEmail) {
+		log.Fatalf("'%s' cannot be combined with '%s'/'%s'", EnvVarCfApiToken, EnvVarCfApiKey, EnvVarCfEmail)
 	}
 
-	zoneId, err := api.ZoneIDByName(zoneName)
-	if err != nil {
-		log.Fatalf("Failed to find zone '%s': %v", zoneName, err)
-	}
+	// cloudflare-go's own retries use a fixed, non-jittered delay and
+	// swallow the Retry-After header, so flareupd does its own jittered
+	// backoff in retry.go instead; disable the library's here to avoid
+	// retrying twice.
+	retryPolicy := cloudflare.UsingRetryPolicy(0, RetryMinDelaySecs, RetryMaxDelaySecs)
 
-	log.Println("Starting flareupd...")
+	if hasToken {
+		api, err := cloudflare.NewWithAPIToken(token, retryPolicy)
+		if err != nil {
+			log.Fatalf("Failed to create cloudflare client: %v", err)
+		}
+		return api
+	}
 
-	ticker := time.Tick(refresh)
-	cancel := make(chan os.Signal, 1)
-	signal.Notify(cancel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	apiKey := requiredEnvVariable(EnvVarCfApiKey)
+	email := requiredEnvVariable(EnvVarCfEmail)
 
-	ip4Updater := &FlareUpdater{
-		Api:     api,
-		Fetcher: &IpFetcher{Url: ip4Url},
-		Type:    "A",
-		ZoneId:  zoneId,
-		Name:    entry + "." + zoneName,
+	api, err := cloudflare.New(apiKey, email, retryPolicy)
+	if err != nil {
+		log.Fatalf("Failed to create cloudflare client: %v", err)
 	}
+	return api
+}
 
-	ip6Updater := &FlareUpdater{
-		Api:     api,
-		Fetcher: &IpFetcher{Url: ip6Url},
-		Type:    "AAAA",
-		ZoneId:  zoneId,
-		Name:    entry + "." + zoneName,
+// resolveZoneId returns the zone's configured ID, or resolves its name via
+// the API when no ID override was given.
+func resolveZoneId(api *cloudflare.API, zone ZoneConfig) (string, error) {
+	if zone.ID != "" {
+		return zone.ID, nil
 	}
 
-	updaters := make([]*FlareUpdater, 0, 2)
-
-	if ip4Updater.Valid() {
-		updaters = append(updaters, ip4Updater)
-	} else {
-		log.Println("IPv4 updater is not valid: disabled")
+	zoneId, err := api.ZoneIDByName(zone.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to find zone '%s': %w", zone.Name, err)
 	}
+	return zoneId, nil
+}
 
-	if ip6Updater.Valid() {
-		updaters = append(updaters, ip6Updater)
-	} else {
-		log.Println("IPv6 updater is not valid: disabled")
+// newIpSource builds the IpSource for a record from its configured
+// sources list, wrapping multiple sources in a ConsensusSource.
+func newIpSource(record RecordConfig) (IpSource, error) {
+	specs := record.Sources
+	if len(specs) == 0 {
+		specs = []string{"http"}
 	}
 
-	for {
-		for _, u := range updaters {
-			if err := u.UpdateContent(); err != nil {
-				log.Printf("Failed to update record: %v", err)
-			}
+	sources := make([]IpSource, 0, len(specs))
+	for _, spec := range specs {
+		source, err := ParseSource(spec, record.Type)
+		if err != nil {
+			return nil, err
 		}
+		sources = append(sources, source)
+	}
 
-		select {
-		case <-ticker:
-			continue
+	if len(sources) == 1 {
+		return sources[0], nil
+	}
 
-		case <-cancel:
-			log.Println("Stopping flareupd...")
-			os.Exit(0)
-		}
+	quorum := record.Quorum
+	if quorum == 0 {
+		quorum = len(sources)
 	}
-}
 
-type FlareUpdater struct {
-	Api     *cloudflare.API
-	Fetcher *IpFetcher
-	Type    string
-	ZoneId  string
-	Name    string
+	return &ConsensusSource{Sources: sources, Quorum: quorum}, nil
 }
 
-func (f *FlareUpdater) Valid() bool {
-	ip, err := f.Fetcher.FetchIp()
-	if err != nil {
-		log.Printf("Failed to fetch an IP from '%s'", f.Fetcher.Url)
-		return false
+// newFlareUpdater builds the updater for a single record.
+func newFlareUpdater(api *cloudflare.API, zoneId string, zoneName string, record RecordConfig, state *State) (*FlareUpdater, error) {
+	switch record.Type {
+	case "A", "AAAA", "CNAME", "TXT":
+	default:
+		return nil, fmt.Errorf("unsupported record type '%s'", record.Type)
 	}
 
-	parsed := net.ParseIP(ip)
-	if parsed == nil {
-		log.Printf("Failed to parse response from '%s' to an IP", f.Fetcher.Url)
-		log.Printf(" -- response: %s", ip)
-		return false
+	if record.Refresh <= 0 {
+		return nil, fmt.Errorf("record '%s': refresh must be set to a positive duration", record.Name)
 	}
 
-	return true
-}
-
-func (f *FlareUpdater) UpdateContent() error {
-	ip, err := f.Fetcher.FetchIp()
+	fetcher, err := newIpSource(record)
 	if err != nil {
-		return err
-	}
+		return nil, err
+	}
+
+	return &FlareUpdater{
+		Api:      api,
+		Fetcher:  fetcher,
+		Type:     record.Type,
+		ZoneId:   zoneId,
+		Name:     record.Name + "." + zoneName,
+		TTL:      record.TTL,
+		Proxied:  record.Proxied,
+		Priority: record.Priority,
+		Refresh:  time.Duration(record.Refresh),
+		State:    state,
+	}, nil
+}
 
-	existing, err := f.Api.DNSRecords(f.ZoneId, cloudflare.DNSRecord{Type: f.Type})
+func main() {
+	configPath := optionalEnvVariable(EnvVarConfigFile, ConfigFile)
+	cfg, err := LoadConfig(configPath)
 	if err != nil {
-		return err
+		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	for _, e := range existing {
-		if e.Name == f.Name {
-			if e.Content == ip {
-				return nil
-			}
+	api := newCloudflareClient()
 
-			return f.update(e.ID, ip)
-		}
+	state, err := LoadState(optionalEnvVariable(EnvVarStateFile, ""))
+	if err != nil {
+		log.Fatalf("Failed to load state: %v", err)
 	}
 
-	return f.create(ip)
-}
-
-func (f *FlareUpdater) update(id string, ip string) error {
-	record := cloudflare.DNSRecord{
-		ID:      id,
-		Type:    f.Type,
-		Name:    f.Name,
-		Content: ip,
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
 
-	log.Printf("Updating record (%s) '%s' to IP '%s'", f.Type, f.Name, ip)
-	return f.Api.UpdateDNSRecord(f.ZoneId, id, record)
-}
+	slog.Info("Starting flareupd...")
 
-func (f *FlareUpdater) create(ip string) error {
-	record := cloudflare.DNSRecord{
-		Type:    f.Type,
-		Name:    f.Name,
-		Content: ip,
-	}
+	var wg sync.WaitGroup
+	var updaters []*FlareUpdater
 
-	log.Printf("Updating record (%s) '%s' to IP '%s'", f.Type, f.Name, ip)
-	_, err := f.Api.CreateDNSRecord(f.ZoneId, record)
-	return err
-}
+	for _, zone := range cfg.Zones {
+		zoneId, err := resolveZoneId(api, zone)
+		if err != nil {
+			slog.Error("Skipping zone", "zone", zone.Name, "error", err)
+			continue
+		}
 
-type IpFetcher struct {
-	Url string
-}
+		for _, record := range zone.Records {
+			updater, err := newFlareUpdater(api, zoneId, zone.Name, record, state)
+			if err != nil {
+				slog.Error("Skipping record", "record", record.Name, "zone", zone.Name, "error", err)
+				continue
+			}
 
-func (i *IpFetcher) FetchIp() (string, error) {
-	res, err := http.DefaultClient.Get(i.Url)
-	if err != nil {
-		return "", err
+			updaters = append(updaters, updater)
+
+			wg.Add(1)
+			go func(u *FlareUpdater) {
+				defer wg.Done()
+				u.Run(ctx)
+			}(updater)
+
+			if record.TLS != nil {
+				manager := &CertManager{
+					Domain:   record.Name + "." + zone.Name,
+					Email:    record.TLS.Email,
+					CertDir:  record.TLS.CertDir,
+					Provider: NewDNSProvider(api, zoneId),
+				}
+
+				wg.Add(1)
+				go func(m *CertManager) {
+					defer wg.Done()
+					m.Run(ctx)
+				}(manager)
+			}
+		}
 	}
 
-	bs, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return "", err
+	if metricsAddr, ok := os.LookupEnv(EnvVarMetricsAddr); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ServeMetrics(ctx, metricsAddr, updaters)
+		}()
 	}
 
-	return strings.TrimSpace(string(bs)), nil
+	wg.Wait()
+	slog.Info("Stopping flareupd...")
 }
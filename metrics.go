@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	ipFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "flareupd_ip_fetch_duration_seconds",
+		Help: "Duration of IP source lookups, labeled by source implementation.",
+	}, []string{"source"})
+
+	ipFetchFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flareupd_ip_fetch_failures_total",
+		Help: "Total number of failed IP source lookups.",
+	}, []string{"source"})
+
+	dnsUpdateTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flareupd_dns_update_total",
+		Help: "Total number of DNS record update attempts.",
+	}, []string{"type", "result"})
+
+	currentIp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flareupd_current_ip",
+		Help: "Always 1; the currently pushed IP is encoded in the 'ip' label.",
+	}, []string{"name", "type", "ip"})
+
+	lastSuccessTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flareupd_last_success_timestamp_seconds",
+		Help: "Unix timestamp of the last successful check per record.",
+	}, []string{"name", "type"})
+)
+
+// ServeMetrics runs the embedded /metrics and /healthz HTTP server on addr
+// until ctx is cancelled.
+func ServeMetrics(ctx context.Context, addr string, updaters []*FlareUpdater) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", healthzHandler(updaters))
+
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	slog.Info("Starting metrics server", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Error("Metrics server failed", "error", err)
+	}
+}
+
+func healthzHandler(updaters []*FlareUpdater) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, u := range updaters {
+			if u.Stale() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintf(w, "record '%s' (%s) has not updated successfully in over %s\n", u.Name, u.Type, 2*u.Refresh)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// withBackoff calls fn, retrying on error up to RetryMaxRetries times with
+// exponential backoff and full jitter between attempts. It stops early,
+// without retrying, once fn returns nil, a cloudflare.NotFoundError (the
+// caller has its own fallback for that), or ctx is cancelled.
+//
+// The Cloudflare client is configured with no retries of its own (see
+// newCloudflareClient) so this is the only backoff applied to API calls.
+// Unlike cloudflare-go's own retry loop, this adds jitter so that many
+// flareupd instances hitting the same rate limit don't retry in lockstep.
+// cloudflare-go v0.70.0 doesn't surface the Retry-After header on a 429
+// response anywhere a caller can read it, so a rate-limited attempt backs
+// off on this same schedule rather than the delay Cloudflare asked for.
+func withBackoff(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || isNotFoundError(err) || attempt == RetryMaxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(jitteredBackoff(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// jitteredBackoff returns a random delay in [0, cap], where cap doubles
+// with each zero-indexed attempt up to RetryMaxDelaySecs.
+func jitteredBackoff(attempt int) time.Duration {
+	capDelay := time.Duration(RetryMaxDelaySecs) * time.Second
+
+	delay := time.Duration(RetryMinDelaySecs) * time.Second << attempt
+	if delay <= 0 || delay > capDelay {
+		delay = capDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
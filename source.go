@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultStunServer = "stun.l.google.com:19302"
+
+	Ip4InfoUrl = "https://v4.ident.me/"
+	Ip6InfoUrl = "https://v6.ident.me/"
+)
+
+// IpSource reports the current public IP a FlareUpdater should push to
+// its DNS record.
+type IpSource interface {
+	FetchIp(ctx context.Context) (string, error)
+}
+
+// ParseSource builds the IpSource named by spec, which is either a bare
+// name ("http", "stun", "upnp", "dns") or a "name:arg" pair ("iface:eth0",
+// "http:https://v4.ident.me/", "stun:stun.example.com:3478"). recordType
+// picks sensible defaults for sources that care about IP family (A vs
+// AAAA).
+func ParseSource(spec string, recordType string) (IpSource, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+
+	switch name {
+	case "http":
+		if arg == "" {
+			arg = defaultHttpUrl(recordType)
+		}
+		return &HttpSource{Url: arg}, nil
+
+	case "stun":
+		if arg == "" {
+			arg = DefaultStunServer
+		}
+		return &StunSource{Server: arg}, nil
+
+	case "iface":
+		if arg == "" {
+			return nil, fmt.Errorf("source 'iface' requires an interface name, e.g. 'iface:eth0'")
+		}
+		return &IfaceSource{Interface: arg, IPv6: recordType == "AAAA"}, nil
+
+	case "upnp":
+		return &UpnpSource{}, nil
+
+	case "dns":
+		return &DnsSource{Resolver: arg}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported IP source '%s'", name)
+	}
+}
+
+func defaultHttpUrl(recordType string) string {
+	if recordType == "AAAA" {
+		return Ip6InfoUrl
+	}
+	return Ip4InfoUrl
+}
+
+// ConsensusSource queries every Sources entry in parallel and only reports
+// an IP once at least Quorum of them agree, guarding against a single
+// flapping or misbehaving source causing a bad DNS update.
+type ConsensusSource struct {
+	Sources []IpSource
+	Quorum  int
+}
+
+func (c *ConsensusSource) FetchIp(ctx context.Context) (string, error) {
+	type result struct {
+		ip  string
+		err error
+	}
+
+	results := make([]result, len(c.Sources))
+	var wg sync.WaitGroup
+
+	for i, source := range c.Sources {
+		wg.Add(1)
+		go func(i int, source IpSource) {
+			defer wg.Done()
+			ip, err := source.FetchIp(ctx)
+			results[i] = result{ip: ip, err: err}
+		}(i, source)
+	}
+	wg.Wait()
+
+	votes := make(map[string]int)
+	order := make([]string, 0, len(results))
+	best := 0
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+
+		if votes[r.ip] == 0 {
+			order = append(order, r.ip)
+		}
+		votes[r.ip]++
+		if votes[r.ip] > best {
+			best = votes[r.ip]
+		}
+	}
+
+	// Walk candidates in the order of the first source (by position in
+	// Sources) that reported each, not map iteration order, so a tie
+	// between two IPs reaching quorum in the same poll resolves the same
+	// way every time instead of flapping.
+	for _, ip := range order {
+		if votes[ip] >= c.Quorum {
+			return ip, nil
+		}
+	}
+
+	return "", fmt.Errorf("no IP source reached quorum (best agreement %d/%d required)", best, c.Quorum)
+}
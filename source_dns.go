@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	CloudflareWhoamiName   = "whoami.cloudflare"
+	CloudflareResolverAddr = "1.1.1.1:53"
+)
+
+// DnsSource resolves the public IP via Cloudflare's "whoami.cloudflare"
+// CHAOS TXT trick (dig TXT ch whoami.cloudflare @1.1.1.1), avoiding a
+// dependency on any HTTP "what's my IP" service.
+type DnsSource struct {
+	Resolver string
+}
+
+func (s *DnsSource) FetchIp(ctx context.Context) (string, error) {
+	resolver := s.Resolver
+	if resolver == "" {
+		resolver = CloudflareResolverAddr
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(CloudflareWhoamiName), dns.TypeTXT)
+	msg.Question[0].Qclass = dns.ClassCHAOS
+
+	client := new(dns.Client)
+	res, _, err := client.ExchangeContext(ctx, msg, resolver)
+	if err != nil {
+		return "", fmt.Errorf("failed to query '%s': %w", resolver, err)
+	}
+
+	for _, answer := range res.Answer {
+		if txt, ok := answer.(*dns.TXT); ok && len(txt.Txt) > 0 {
+			return strings.Join(txt.Txt, ""), nil
+		}
+	}
+
+	return "", fmt.Errorf("no TXT answer from '%s'", resolver)
+}
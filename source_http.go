@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// HttpSource fetches the current IP by GETing a plain-text "what's my IP"
+// endpoint, e.g. https://v4.ident.me/.
+type HttpSource struct {
+	Url string
+}
+
+func (h *HttpSource) FetchIp(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.Url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	bs, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(bs)), nil
+}
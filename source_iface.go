@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// IfaceSource reads the IP directly off a local network interface, for
+// setups where the WAN address is assigned straight to an interface
+// instead of being discoverable via an external service.
+type IfaceSource struct {
+	Interface string
+	IPv6      bool
+}
+
+func (s *IfaceSource) FetchIp(ctx context.Context) (string, error) {
+	iface, err := net.InterfaceByName(s.Interface)
+	if err != nil {
+		return "", fmt.Errorf("failed to find interface '%s': %w", s.Interface, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("failed to read addresses of '%s': %w", s.Interface, err)
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ip := ipNet.IP
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+
+		isV4 := ip.To4() != nil
+		if isV4 == s.IPv6 {
+			continue
+		}
+
+		return ip.String(), nil
+	}
+
+	return "", fmt.Errorf("no suitable address found on interface '%s'", s.Interface)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pion/stun"
+)
+
+// StunSource discovers the public IP via a STUN binding request, useful
+// behind NATs where no local interface carries the WAN address.
+type StunSource struct {
+	Server string
+}
+
+func (s *StunSource) FetchIp(ctx context.Context) (string, error) {
+	conn, err := stun.Dial("udp", s.Server)
+	if err != nil {
+		return "", fmt.Errorf("failed to dial STUN server '%s': %w", s.Server, err)
+	}
+	defer conn.Close()
+
+	message := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+
+	var ip string
+	var xorErr error
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conn.Do(message, func(res stun.Event) {
+			if res.Error != nil {
+				xorErr = res.Error
+				return
+			}
+
+			var xorAddr stun.XORMappedAddress
+			if xorErr = xorAddr.GetFrom(res.Message); xorErr != nil {
+				return
+			}
+			ip = xorAddr.IP.String()
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", fmt.Errorf("STUN request to '%s' failed: %w", s.Server, err)
+		}
+
+	case <-ctx.Done():
+		// conn.Do blocks on the socket with no context of its own; closing
+		// the connection out from under it is the only way to unblock it.
+		conn.Close()
+		<-done
+		return "", ctx.Err()
+	}
+
+	if xorErr != nil {
+		return "", fmt.Errorf("STUN response from '%s' invalid: %w", s.Server, xorErr)
+	}
+
+	return ip, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type fakeSource struct {
+	ip  string
+	err error
+}
+
+func (f *fakeSource) FetchIp(ctx context.Context) (string, error) {
+	return f.ip, f.err
+}
+
+func TestConsensusSourceFetchIp(t *testing.T) {
+	t.Run("quorum reached", func(t *testing.T) {
+		c := &ConsensusSource{
+			Sources: []IpSource{
+				&fakeSource{ip: "1.1.1.1"},
+				&fakeSource{ip: "1.1.1.1"},
+				&fakeSource{ip: "2.2.2.2"},
+			},
+			Quorum: 2,
+		}
+
+		ip, err := c.FetchIp(context.Background())
+		if err != nil {
+			t.Fatalf("FetchIp() returned %v", err)
+		}
+		if ip != "1.1.1.1" {
+			t.Errorf("FetchIp() = %q, want %q", ip, "1.1.1.1")
+		}
+	})
+
+	t.Run("quorum not reached", func(t *testing.T) {
+		c := &ConsensusSource{
+			Sources: []IpSource{
+				&fakeSource{ip: "1.1.1.1"},
+				&fakeSource{ip: "2.2.2.2"},
+				&fakeSource{ip: "3.3.3.3"},
+			},
+			Quorum: 2,
+		}
+
+		if _, err := c.FetchIp(context.Background()); err == nil {
+			t.Fatal("FetchIp() returned nil error, want an error")
+		}
+	})
+
+	t.Run("failed sources don't count towards quorum", func(t *testing.T) {
+		c := &ConsensusSource{
+			Sources: []IpSource{
+				&fakeSource{ip: "1.1.1.1"},
+				&fakeSource{err: errors.New("boom")},
+				&fakeSource{ip: "1.1.1.1"},
+			},
+			Quorum: 2,
+		}
+
+		ip, err := c.FetchIp(context.Background())
+		if err != nil {
+			t.Fatalf("FetchIp() returned %v", err)
+		}
+		if ip != "1.1.1.1" {
+			t.Errorf("FetchIp() = %q, want %q", ip, "1.1.1.1")
+		}
+	})
+
+	// Two IPs reaching quorum in the same poll must resolve to the same
+	// winner on every call, not whichever the map iteration visits first.
+	t.Run("tie resolves deterministically", func(t *testing.T) {
+		c := &ConsensusSource{
+			Sources: []IpSource{
+				&fakeSource{ip: "1.1.1.1"},
+				&fakeSource{ip: "1.1.1.1"},
+				&fakeSource{ip: "2.2.2.2"},
+				&fakeSource{ip: "2.2.2.2"},
+			},
+			Quorum: 2,
+		}
+
+		for i := 0; i < 50; i++ {
+			ip, err := c.FetchIp(context.Background())
+			if err != nil {
+				t.Fatalf("FetchIp() returned %v", err)
+			}
+			if ip != "1.1.1.1" {
+				t.Fatalf("FetchIp() = %q on iteration %d, want stable %q", ip, i, "1.1.1.1")
+			}
+		}
+	})
+}
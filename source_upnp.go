@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/huin/goupnp/dcps/internetgateway2"
+)
+
+// UpnpSource asks the LAN gateway for the WAN IP it has via UPnP IGD,
+// which works without any outbound request to a third party.
+type UpnpSource struct{}
+
+func (s *UpnpSource) FetchIp(ctx context.Context) (string, error) {
+	clients, _, err := internetgateway2.NewWANIPConnection1ClientsCtx(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to discover UPnP gateway: %w", err)
+	}
+	if len(clients) == 0 {
+		return "", fmt.Errorf("no UPnP gateway found")
+	}
+
+	ip, err := clients[0].GetExternalIPAddressCtx(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to query UPnP gateway: %w", err)
+	}
+
+	return ip, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RecordState is the last known server-side record ID and pushed IP for
+// one record, cached so a restart doesn't need a fresh DNSRecords lookup
+// when the IP hasn't changed.
+type RecordState struct {
+	ID string `json:"id"`
+	IP string `json:"ip"`
+}
+
+// State is the cache of RecordState keyed by "name/type", shared by every
+// FlareUpdater in the process and optionally persisted to disk.
+type State struct {
+	mu      sync.Mutex
+	path    string
+	Records map[string]RecordState `json:"records"`
+}
+
+func recordStateKey(name, recordType string) string {
+	return name + "/" + recordType
+}
+
+// LoadState reads the state file at path, returning an empty State if it
+// doesn't exist yet. path may be empty, in which case the state is kept
+// in memory only and Set never writes to disk.
+func LoadState(path string) (*State, error) {
+	s := &State{path: path, Records: make(map[string]RecordState)}
+	if path == "" {
+		return s, nil
+	}
+
+	bs, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file '%s': %w", path, err)
+	}
+
+	if err := json.Unmarshal(bs, s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file '%s': %w", path, err)
+	}
+	s.path = path
+
+	return s, nil
+}
+
+func (s *State) Get(name, recordType string) (RecordState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rs, ok := s.Records[recordStateKey(name, recordType)]
+	return rs, ok
+}
+
+// Set records the latest known state for name/recordType and, if this
+// State was given a non-empty file path, persists the whole cache to it.
+func (s *State) Set(name, recordType string, rs RecordState) error {
+	s.mu.Lock()
+	s.Records[recordStateKey(name, recordType)] = rs
+	path := s.path
+	bs, err := json.Marshal(s)
+	s.mu.Unlock()
+
+	if err != nil || path == "" {
+		return err
+	}
+
+	// Each call writes to its own temp file (rather than a fixed
+	// path+".tmp") since multiple FlareUpdaters share one State and may
+	// call Set concurrently; a shared tmp name would let one writer's
+	// file be truncated or renamed out from under another.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for state file '%s': %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file '%s': %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file '%s': %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("failed to write state file '%s': %w", path, err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
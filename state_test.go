@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStateGetSetInMemory(t *testing.T) {
+	s, err := LoadState("")
+	if err != nil {
+		t.Fatalf("LoadState(\"\") returned %v", err)
+	}
+
+	if _, ok := s.Get("home.example.com", "A"); ok {
+		t.Fatal("Get() on empty state returned ok=true")
+	}
+
+	want := RecordState{ID: "abc123", IP: "1.2.3.4"}
+	if err := s.Set("home.example.com", "A", want); err != nil {
+		t.Fatalf("Set() returned %v", err)
+	}
+
+	got, ok := s.Get("home.example.com", "A")
+	if !ok || got != want {
+		t.Errorf("Get() = %+v, %v, want %+v, true", got, ok, want)
+	}
+}
+
+func TestStateRoundTripsThroughFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState(%q) returned %v", path, err)
+	}
+
+	want := RecordState{ID: "abc123", IP: "1.2.3.4"}
+	if err := s.Set("home.example.com", "A", want); err != nil {
+		t.Fatalf("Set() returned %v", err)
+	}
+
+	reloaded, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState(%q) returned %v", path, err)
+	}
+
+	got, ok := reloaded.Get("home.example.com", "A")
+	if !ok || got != want {
+		t.Errorf("Get() after reload = %+v, %v, want %+v, true", got, ok, want)
+	}
+}
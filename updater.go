@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// FlareUpdater keeps a single DNS record in sync with the IP its Fetcher
+// reports, on its own Refresh interval.
+type FlareUpdater struct {
+	Api      *cloudflare.API
+	Fetcher  IpSource
+	Type     string
+	ZoneId   string
+	Name     string
+	TTL      int
+	Proxied  *bool
+	Priority *uint16
+	Refresh  time.Duration
+	State    *State
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+}
+
+// Run drives the updater's ticker loop until ctx is cancelled.
+func (f *FlareUpdater) Run(ctx context.Context) {
+	if !f.Valid(ctx) {
+		slog.Warn("Updater is not valid: disabled", "name", f.Name, "type", f.Type)
+		return
+	}
+
+	f.markSuccess()
+
+	ticker := time.NewTicker(f.Refresh)
+	defer ticker.Stop()
+
+	for {
+		if err := f.UpdateContent(ctx); err != nil {
+			slog.Error("Failed to update record", "name", f.Name, "type", f.Type, "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+			continue
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *FlareUpdater) Valid(ctx context.Context) bool {
+	content, err := f.fetchIp(ctx)
+	if err != nil {
+		slog.Warn("Failed to fetch an IP", "name", f.Name, "error", err)
+		return false
+	}
+
+	if content == "" {
+		slog.Warn("IP source returned an empty response", "name", f.Name)
+		return false
+	}
+
+	if f.Type != "A" && f.Type != "AAAA" {
+		return true
+	}
+
+	if net.ParseIP(content) == nil {
+		slog.Warn("Failed to parse IP source response", "name", f.Name, "response", content)
+		return false
+	}
+
+	return true
+}
+
+// Stale reports whether this updater has not completed a successful check
+// in over 2*Refresh, used by the /healthz endpoint.
+func (f *FlareUpdater) Stale() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return time.Since(f.lastSuccess) > 2*f.Refresh
+}
+
+func (f *FlareUpdater) markSuccess() {
+	f.mu.Lock()
+	f.lastSuccess = time.Now()
+	f.mu.Unlock()
+
+	lastSuccessTimestamp.WithLabelValues(f.Name, f.Type).SetToCurrentTime()
+}
+
+// fetchIp fetches the current IP, recording fetch duration/failure metrics.
+func (f *FlareUpdater) fetchIp(ctx context.Context) (string, error) {
+	source := fmt.Sprintf("%T", f.Fetcher)
+
+	start := time.Now()
+	ip, err := f.Fetcher.FetchIp(ctx)
+	ipFetchDuration.WithLabelValues(source).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		ipFetchFailures.WithLabelValues(source).Inc()
+	}
+
+	return ip, err
+}
+
+func (f *FlareUpdater) UpdateContent(ctx context.Context) error {
+	ip, err := f.fetchIp(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cached, ok := f.State.Get(f.Name, f.Type); ok {
+		if cached.IP == ip {
+			f.markSuccess()
+			dnsUpdateTotal.WithLabelValues(f.Type, "unchanged").Inc()
+			currentIp.WithLabelValues(f.Name, f.Type, ip).Set(1)
+			return nil
+		}
+
+		err := f.update(ctx, cached.ID, cached.IP, ip)
+		switch {
+		case err == nil:
+			return nil
+
+		case isNotFoundError(err):
+			// The cached ID no longer exists upstream; fall through to a
+			// fresh lookup below instead of counting this as a failed
+			// update, since it's about to be retried and correctly
+			// classified either way.
+			slog.Warn("Cached record ID is stale, refreshing from the API", "name", f.Name, "type", f.Type)
+
+		default:
+			dnsUpdateTotal.WithLabelValues(f.Type, "error").Inc()
+			return err
+		}
+	}
+
+	var existing []cloudflare.DNSRecord
+	err = withBackoff(ctx, func() error {
+		var listErr error
+		existing, _, listErr = f.Api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier(f.ZoneId), cloudflare.ListDNSRecordsParams{Type: f.Type})
+		return listErr
+	})
+	if err != nil {
+		dnsUpdateTotal.WithLabelValues(f.Type, "error").Inc()
+		return err
+	}
+
+	for _, e := range existing {
+		if e.Name == f.Name {
+			if e.Content == ip {
+				f.markSuccess()
+				dnsUpdateTotal.WithLabelValues(f.Type, "unchanged").Inc()
+				currentIp.WithLabelValues(f.Name, f.Type, ip).Set(1)
+				f.saveState(e.ID, ip)
+				return nil
+			}
+
+			if err := f.update(ctx, e.ID, e.Content, ip); err != nil {
+				dnsUpdateTotal.WithLabelValues(f.Type, "error").Inc()
+				return err
+			}
+			return nil
+		}
+	}
+
+	return f.create(ctx, ip)
+}
+
+// update pushes ip to the existing record id, replacing its previous
+// content oldIP. The caller is responsible for counting a returned error
+// against dnsUpdateTotal: a cloudflare.NotFoundError from a stale cached
+// id isn't a real failure, so it shouldn't be counted as one.
+func (f *FlareUpdater) update(ctx context.Context, id string, oldIP string, ip string) error {
+	params := cloudflare.UpdateDNSRecordParams{
+		ID:       id,
+		Type:     f.Type,
+		Name:     f.Name,
+		Content:  ip,
+		TTL:      f.TTL,
+		Proxied:  f.Proxied,
+		Priority: f.Priority,
+	}
+
+	slog.Info("Updating record", "type", f.Type, "name", f.Name, "ip", ip)
+	err := withBackoff(ctx, func() error {
+		_, err := f.Api.UpdateDNSRecord(ctx, cloudflare.ZoneIdentifier(f.ZoneId), params)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	f.markSuccess()
+	dnsUpdateTotal.WithLabelValues(f.Type, "updated").Inc()
+	f.setCurrentIp(oldIP, ip)
+	f.saveState(id, ip)
+	return nil
+}
+
+// setCurrentIp sets the currentIp gauge for ip and, if oldIP was a
+// different value, deletes its now-stale series so flareupd_current_ip
+// doesn't accumulate one series per IP a record has ever held. The
+// gauge is keyed by name as well as type so this never touches another
+// record's series, even when two records share a type.
+func (f *FlareUpdater) setCurrentIp(oldIP string, ip string) {
+	if oldIP != "" && oldIP != ip {
+		currentIp.DeleteLabelValues(f.Name, f.Type, oldIP)
+	}
+	currentIp.WithLabelValues(f.Name, f.Type, ip).Set(1)
+}
+
+func (f *FlareUpdater) create(ctx context.Context, ip string) error {
+	params := cloudflare.CreateDNSRecordParams{
+		Type:     f.Type,
+		Name:     f.Name,
+		Content:  ip,
+		TTL:      f.TTL,
+		Proxied:  f.Proxied,
+		Priority: f.Priority,
+	}
+
+	slog.Info("Creating record", "type", f.Type, "name", f.Name, "ip", ip)
+	var res cloudflare.DNSRecord
+	err := withBackoff(ctx, func() error {
+		var createErr error
+		res, createErr = f.Api.CreateDNSRecord(ctx, cloudflare.ZoneIdentifier(f.ZoneId), params)
+		return createErr
+	})
+	if err != nil {
+		dnsUpdateTotal.WithLabelValues(f.Type, "error").Inc()
+		return err
+	}
+
+	f.markSuccess()
+	dnsUpdateTotal.WithLabelValues(f.Type, "created").Inc()
+	currentIp.WithLabelValues(f.Name, f.Type, ip).Set(1)
+	f.saveState(res.ID, ip)
+	return nil
+}
+
+func (f *FlareUpdater) saveState(id string, ip string) {
+	if err := f.State.Set(f.Name, f.Type, RecordState{ID: id, IP: ip}); err != nil {
+		slog.Warn("Failed to persist state file", "name", f.Name, "error", err)
+	}
+}
+
+// isNotFoundError reports whether err is a Cloudflare API error for a
+// record that no longer exists, meaning a cached record ID must be
+// refreshed.
+func isNotFoundError(err error) bool {
+	var notFound cloudflare.NotFoundError
+	return errors.As(err, &notFound)
+}